@@ -0,0 +1,69 @@
+package cache
+
+import (
+  "crypto/sha256"
+  "encoding/hex"
+  "os"
+  "path/filepath"
+)
+
+// Cache stores opaque byte blobs on disk, keyed by an id the caller derives
+// from whatever makes an entry stale (source mtime, size, config, ...).
+type Cache struct {
+  dir string
+}
+
+// New returns a Cache backed by dir, creating it if necessary. An empty dir
+// falls back to DefaultDir.
+func New(dir string) (*Cache, error) {
+  if dir == "" {
+    dir = DefaultDir()
+  }
+
+  if err := os.MkdirAll(dir, 0755); err != nil {
+    return nil, err
+  }
+
+  return &Cache{dir: dir}, nil
+}
+
+// DefaultDir returns $XDG_CACHE_HOME/obsidian-for-hugo, falling back to
+// ~/.cache/obsidian-for-hugo when XDG_CACHE_HOME is unset.
+func DefaultDir() string {
+  if xdgDir := os.Getenv("XDG_CACHE_HOME"); xdgDir != "" {
+    return filepath.Join(xdgDir, "obsidian-for-hugo")
+  }
+
+  home, err := os.UserHomeDir()
+  if err != nil {
+    return filepath.Join(os.TempDir(), "obsidian-for-hugo")
+  }
+
+  return filepath.Join(home, ".cache", "obsidian-for-hugo")
+}
+
+func (c *Cache) entryPath(id string) string {
+  sum := sha256.Sum256([]byte(id))
+  return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// GetOrCreateBytes returns the bytes cached under id, or calls create and
+// persists its result when no entry exists yet.
+func (c *Cache) GetOrCreateBytes(id string, create func() ([]byte, error)) ([]byte, error) {
+  entryPath := c.entryPath(id)
+
+  if cached, err := os.ReadFile(entryPath); err == nil {
+    return cached, nil
+  }
+
+  data, err := create()
+  if err != nil {
+    return nil, err
+  }
+
+  if err := os.WriteFile(entryPath, data, 0644); err != nil {
+    return nil, err
+  }
+
+  return data, nil
+}
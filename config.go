@@ -0,0 +1,96 @@
+package main
+
+import (
+  "os"
+  "path/filepath"
+
+  "github.com/BurntSushi/toml"
+  "gopkg.in/yaml.v2"
+)
+
+// FileConfig is the on-disk shape of the config file, discovered at
+// ./obsidian-for-hugo.yaml or passed via -config. It's kept separate from
+// Config because Config carries resolved processor funcs, which aren't
+// something a YAML/TOML file can express directly - see Processors below.
+type FileConfig struct {
+  SiteDir string `yaml:"site_dir" toml:"site_dir"`
+  Include []string `yaml:"include" toml:"include"`
+  Exclude []string `yaml:"exclude" toml:"exclude"`
+  FolderMappings map[string]string `yaml:"folder_mappings" toml:"folder_mappings"`
+  DraftFolders []string `yaml:"draft_folders" toml:"draft_folders"`
+  TagFromFolder bool `yaml:"tag_from_folder" toml:"tag_from_folder"`
+  Processors []string `yaml:"processors" toml:"processors"`
+}
+
+// defaultConfigFilename is where LoadConfigFile looks when -config isn't set.
+const defaultConfigFilename = "obsidian-for-hugo.yaml"
+
+// defaultProcessorNames is the pipeline used when the config file doesn't
+// list one: the tool's historical title/slug/date/wikilinks steps plus the
+// vcs-date, lastmod, folder-rules and embeds processors.
+var defaultProcessorNames = []string{"title", "slug", "vcs-date", "date", "lastmod", "folder-rules", "embeds", "wikilinks"}
+
+// LoadConfigFile reads and decodes path, picking a decoder from its
+// extension: .toml uses TOML, anything else is treated as YAML.
+func LoadConfigFile(path string) (FileConfig, error) {
+  var fileConfig FileConfig
+
+  data, err := os.ReadFile(path)
+  if err != nil {
+    return fileConfig, err
+  }
+
+  if filepath.Ext(path) == ".toml" {
+    err = toml.Unmarshal(data, &fileConfig)
+  } else {
+    err = yaml.Unmarshal(data, &fileConfig)
+  }
+
+  return fileConfig, err
+}
+
+// FrontMatterProcessors and ContentProcessors are registered by name here so
+// a config file's Processors list can enable/reorder/disable them without
+// the caller needing a reference to the underlying func. Third parties can
+// populate these same registries from an init() in their own plugin package.
+var frontMatterProcessorRegistry = map[string]FrontMatterProcessor{}
+var contentProcessorRegistry = map[string]ContentProcessor{}
+
+func RegisterFrontMatterProcessor(name string, processor FrontMatterProcessor) {
+  frontMatterProcessorRegistry[name] = processor
+}
+
+func RegisterContentProcessor(name string, processor ContentProcessor) {
+  contentProcessorRegistry[name] = processor
+}
+
+func init() {
+  RegisterFrontMatterProcessor("title", addFallbackFrontMatterTitle)
+  RegisterFrontMatterProcessor("slug", addFallbackFrontMatterSlug)
+  RegisterFrontMatterProcessor("date", addFallbackFrontMatterDate)
+  RegisterFrontMatterProcessor("lastmod", addFallbackFrontMatterLastmod)
+  RegisterFrontMatterProcessor("folder-rules", applyFolderRules)
+  RegisterContentProcessor("embeds", convertEmbeds)
+  RegisterContentProcessor("wikilinks", convertWikiLinks)
+}
+
+// resolveProcessors looks up each name in turn against both registries,
+// preserving the relative order names were given in within each resulting
+// slice. A name that isn't registered in either is silently skipped, so a
+// config file referencing a processor from a plugin that isn't built in
+// doesn't hard-fail the whole run.
+func resolveProcessors(names []string) ([]FrontMatterProcessor, []ContentProcessor) {
+  var frontMatterProcessors []FrontMatterProcessor
+  var contentProcessors []ContentProcessor
+
+  for _, name := range names {
+    if processor, ok := frontMatterProcessorRegistry[name]; ok {
+      frontMatterProcessors = append(frontMatterProcessors, processor)
+    }
+    if processor, ok := contentProcessorRegistry[name]; ok {
+      contentProcessors = append(contentProcessors, processor)
+    }
+  }
+
+  return frontMatterProcessors, contentProcessors
+}
@@ -1,34 +1,59 @@
 package main
 
 import (
+  "bytes"
+  "crypto/sha256"
+  "encoding/hex"
   "fmt"
   "flag"
-  "io/ioutil"
+  "io/fs"
   "os"
-  "os/exec"
   "path"
+  "path/filepath"
+  "reflect"
   "regexp"
-  "strings"
+  "runtime"
   "strconv"
+  "strings"
   "sync"
   "time"
 
+  "github.com/JenkinsDev/obsidian-for-hugo/cache"
   "github.com/adrg/frontmatter"
-  "github.com/creack/pty"
+  "github.com/go-git/go-git/v5"
+  "github.com/go-git/go-git/v5/plumbing/object"
   "gopkg.in/yaml.v2"
 )
 
+// converterVersion is bumped whenever a change to rendering logic would make
+// previously cached output stale.
+const converterVersion = "2"
+
 var help = flag.Bool("help", false, "Show help")
 var vaultDir = flag.String("vault-path", "", "Path to Obsidian vault")
 var outputDir = flag.String("content-path", "", "Path to Hugo content output directory (does not have to be content root)")
+var cacheDir = flag.String("cache-path", "", "Path to the file cache directory (default $XDG_CACHE_HOME/obsidian-for-hugo)")
+var sitePath = flag.String("site-path", "", "Path to the Hugo site root (default: the nearest ancestor of content-path holding a Hugo config file)")
+var configPath = flag.String("config", "", "Path to a YAML/TOML config file (default ./"+defaultConfigFilename+" if present)")
+var watch = flag.Bool("watch", false, "Watch the vault for changes and reconvert affected files after the initial conversion")
 var wg sync.WaitGroup
 
 var wikiLinkRegex = regexp.MustCompile(`\[\[(.*?)\]\]`)
+var embedRegex = regexp.MustCompile(`!\[\[(.*?)\]\]`)
+var imageExtRegex = regexp.MustCompile(`(?i)\.(png|jpe?g|gif|svg|webp|bmp)$`)
 var slugifyRegex = regexp.MustCompile(`[^a-zA-Z0-9]`)
 
+// refEmbedShortcodeTemplate is written to the Hugo site's shortcodes
+// directory after each run whose pipeline includes convertEmbeds, unless a
+// `ref-embed` shortcode is already there.
+const refEmbedShortcodeTemplate = `{{ $parts := split (.Get 0) "#" }}
+<a href="{{ (.Site.GetPage (index $parts 0)).RelPermalink }}{{ if gt (len $parts) 1 }}#{{ index $parts 1 }}{{ end }}">{{ (.Site.GetPage (index $parts 0)).Title }}</a>
+`
+
 type FrontMatter struct {
   Title string `yaml:"title"`
   Date string `yaml:"date"`
+  Lastmod string `yaml:"lastmod"`
   Draft bool `yaml:"draft"`
   Tags []string `yaml:"tags"`
   Categories []string `yaml:"categories"`
@@ -48,10 +73,42 @@ type ContentProcessor = func(Config, File, []byte) []byte
 type Config struct {
   VaultDir string
   OutputDir string
+  CacheDir string
+  SiteDir string
+  Include []string
+  Exclude []string
+  FolderMappings map[string]string
+  DraftFolders []string
+  TagFromFolder bool
   FrontMatterProcessors []FrontMatterProcessor
   ContentProcessors []ContentProcessor
 }
 
+// writtenPaths tracks output paths produced by the current run so that
+// ConvertObsidianToHugo can sweep away outputs whose sources disappeared,
+// without needing to RemoveAll the output directory up front.
+type writtenPaths struct {
+  mu sync.Mutex
+  paths map[string]struct{}
+}
+
+func newWrittenPaths() *writtenPaths {
+  return &writtenPaths{paths: make(map[string]struct{})}
+}
+
+func (w *writtenPaths) add(path string) {
+  w.mu.Lock()
+  defer w.mu.Unlock()
+  w.paths[path] = struct{}{}
+}
+
+func (w *writtenPaths) has(path string) bool {
+  w.mu.Lock()
+  defer w.mu.Unlock()
+  _, ok := w.paths[path]
+  return ok
+}
+
 func addFallbackFrontMatterTitle(config Config, file File, frontMatter *FrontMatter) {
   if frontMatter.Title == "" {
     frontMatter.Title = file.Title
@@ -65,28 +122,129 @@ func addFallbackFrontMatterSlug(config Config, file File, frontMatter *FrontMatt
   }
 }
 
-func attemptGitDate(config Config, file File, frontMatter *FrontMatter) {
-  gitRoot, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+// vcsDates holds the earliest and latest committer times found for a path.
+type vcsDates struct {
+  created time.Time
+  modified time.Time
+  ok bool
+}
+
+// VCSDateProcessor derives a note's creation/modification dates from its commit
+// history instead of the filesystem, so dates survive clones and CI checkouts.
+// It opens the repository once and caches the resolved dates per relative path,
+// since walking commit history is the expensive part, not the lookup itself.
+type VCSDateProcessor struct {
+  repo *git.Repository
+  root string
+  cache map[string]vcsDates
+  mu sync.Mutex
+}
+
+// NewVCSDateProcessor opens the git repository containing vaultDir, if any. If
+// vaultDir is not inside a git working tree, the returned processor silently
+// no-ops on every call instead of erroring.
+func NewVCSDateProcessor(vaultDir string) *VCSDateProcessor {
+  processor := &VCSDateProcessor{cache: make(map[string]vcsDates)}
+
+  repo, err := git.PlainOpenWithOptions(vaultDir, &git.PlainOpenOptions{DetectDotGit: true})
   if err != nil {
-    return
+    return processor
+  }
+
+  worktree, err := repo.Worktree()
+  if err != nil {
+    return processor
+  }
+
+  processor.repo = repo
+  processor.root = worktree.Filesystem.Root()
+
+  return processor
+}
+
+func (p *VCSDateProcessor) datesFor(file File) (vcsDates, bool) {
+  if p.repo == nil {
+    return vcsDates{}, false
   }
 
-  command := exec.Command("git", "--no-pager", "log", "-1", "--format=%ad", "--date=unix",  "--", file.Path)
-  command.Dir = string(gitRoot)
+  // p.root (worktree.Filesystem.Root()) is always absolute, but file.Path
+  // takes whatever form -vault-path was passed in - filepath.Rel errors
+  // unless both arguments are absolute or both are relative, so a relative
+  // -vault-path would otherwise always fail here and silently no-op.
+  absPath, err := filepath.Abs(file.Path)
+  if err != nil {
+    return vcsDates{}, false
+  }
 
-  // git log will only output to STDOUT if it's a terminal, so we need to create a PTY to capture the output
-  ptmx, err := pty.Start(command)
+  relPath, err := filepath.Rel(p.root, absPath)
   if err != nil {
-    return
+    return vcsDates{}, false
+  }
+  relPath = filepath.ToSlash(relPath)
+
+  p.mu.Lock()
+  defer p.mu.Unlock()
+
+  if cached, ok := p.cache[relPath]; ok {
+    return cached, cached.ok
   }
 
-  defer ptmx.Close()
-  output, err := ioutil.ReadAll(ptmx)
+  dates := p.resolveDates(relPath)
+  p.cache[relPath] = dates
 
+  return dates, dates.ok
+}
+
+func (p *VCSDateProcessor) resolveDates(relPath string) vcsDates {
+  head, err := p.repo.Head()
+  if err != nil {
+    return vcsDates{}
+  }
+
+  commits, err := p.repo.Log(&git.LogOptions{
+    From: head.Hash(),
+    PathFilter: func(path string) bool { return path == relPath },
+  })
+  if err != nil {
+    return vcsDates{}
+  }
+
+  var dates vcsDates
+  err = commits.ForEach(func(commit *object.Commit) error {
+    when := commit.Committer.When
+
+    if !dates.ok || when.Before(dates.created) {
+      dates.created = when
+    }
+    if !dates.ok || when.After(dates.modified) {
+      dates.modified = when
+    }
+
+    dates.ok = true
+    return nil
+  })
   if err != nil {
-    timestamp := strings.TrimSpace(string(output))
-    i, _ := strconv.ParseInt(timestamp, 10, 64)
-    frontMatter.Date = time.Unix(i, 0).Format(time.RFC3339)
+    return vcsDates{}
+  }
+
+  return dates
+}
+
+// AddFrontMatterDates fills in Date and Lastmod from commit history. It is a
+// FrontMatterProcessor and leaves both fields untouched when the vault isn't
+// a git working tree or the file has no commit history yet.
+func (p *VCSDateProcessor) AddFrontMatterDates(config Config, file File, frontMatter *FrontMatter) {
+  dates, ok := p.datesFor(file)
+  if !ok {
+    return
+  }
+
+  if frontMatter.Date == "" {
+    frontMatter.Date = dates.created.Format(time.RFC3339)
+  }
+
+  if frontMatter.Lastmod == "" {
+    frontMatter.Lastmod = dates.modified.Format(time.RFC3339)
   }
 }
 
@@ -100,38 +258,218 @@ func attemptFileDate(config Config, file File, frontMatter *FrontMatter) {
 }
 
 func addFallbackFrontMatterDate(config Config, file File, frontMatter *FrontMatter) {
-  if frontMatter.Date == "" {
-    attemptGitDate(config, file, frontMatter)
-  }
-
   if frontMatter.Date == "" {
     attemptFileDate(config, file, frontMatter)
   }
-  
+
   if frontMatter.Date == "" {
     frontMatter.Date = time.Now().Format(time.RFC3339)
   }
 }
 
+// addFallbackFrontMatterLastmod defaults Lastmod to Date. Unlike Date,
+// Lastmod has no filesystem-based fallback of its own - VCSDateProcessor only
+// sets it when the vault is a git working tree with history for the file -
+// so without this, every other vault would emit a literal `lastmod: ""`.
+// Must run after the Date fallbacks have had a chance to fill in Date.
+func addFallbackFrontMatterLastmod(config Config, file File, frontMatter *FrontMatter) {
+  if frontMatter.Lastmod == "" {
+    frontMatter.Lastmod = frontMatter.Date
+  }
+}
+
+// relativeToVault returns fullPath as a slash-separated path relative to
+// config.VaultDir, falling back to fullPath itself if it isn't under it.
+func relativeToVault(config Config, fullPath string) string {
+  relPath, err := filepath.Rel(config.VaultDir, fullPath)
+  if err != nil {
+    return fullPath
+  }
+
+  return filepath.ToSlash(relPath)
+}
+
+// matchesFolder reports whether relDir is one of folders, or nested under
+// one of them.
+func matchesFolder(folders []string, relDir string) bool {
+  for _, folder := range folders {
+    folder = strings.Trim(folder, "/")
+    if relDir == folder || strings.HasPrefix(relDir, folder+"/") {
+      return true
+    }
+  }
+
+  return false
+}
+
+// applyFolderRules forces Draft when the note lives under a configured
+// DraftFolders entry, and, when TagFromFolder is set, appends each parent
+// folder name as a tag. Both are no-ops when their config fields are unset.
+func applyFolderRules(config Config, file File, frontMatter *FrontMatter) {
+  relDir := path.Dir(relativeToVault(config, file.Path))
+  if relDir == "." {
+    relDir = ""
+  }
+
+  if matchesFolder(config.DraftFolders, relDir) {
+    frontMatter.Draft = true
+  }
+
+  if config.TagFromFolder && relDir != "" {
+    frontMatter.Tags = append(frontMatter.Tags, strings.Split(relDir, "/")...)
+  }
+}
+
 func convertWikiLinks(config Config, file File, contents []byte) []byte {
   contents = wikiLinkRegex.ReplaceAllFunc(contents, func(match []byte) []byte {
     link := string(match[2:len(match)-2])
 
+    alias, hasAlias := "", false
+    if pipeIndex := strings.Index(link, "|"); pipeIndex != -1 {
+      alias = link[pipeIndex+1:]
+      link = link[:pipeIndex]
+      hasAlias = true
+    }
+
     if strings.Contains(link, "#") {
       heading := link[strings.Index(link, "#")+1:]
       heading = strings.ReplaceAll(heading, " ", "-")
       heading = strings.ToLower(heading)
-
       link = link[0:strings.Index(link, "#")]
-      return []byte(fmt.Sprintf("[%s]({{< ref \"%s#%s\" >}})", link, link, heading))
+
+      display := link
+      if hasAlias {
+        display = alias
+      }
+      return []byte(fmt.Sprintf("[%s]({{< ref \"%s#%s\" >}})", display, link, heading))
+    }
+
+    display := link
+    if hasAlias {
+      display = alias
     }
+    return []byte(fmt.Sprintf("[%s]({{< ref \"%s\" >}})", display, link))
+  })
+
+  return contents
+}
 
-    return []byte(fmt.Sprintf("[%s]({{< ref \"%s\" >}})", link, link))
+// convertEmbeds expands Obsidian's `![[...]]` embed syntax. It must run
+// before convertWikiLinks, since an untouched `![[target]]` would otherwise
+// also be matched by the plain wiki-link regex.
+func convertEmbeds(config Config, file File, contents []byte) []byte {
+  contents = embedRegex.ReplaceAllFunc(contents, func(match []byte) []byte {
+    return []byte(renderEmbed(string(match[3 : len(match)-2])))
   })
 
   return contents
 }
 
+// renderEmbed expands a single embed target (the text between `![[` and
+// `]]`) into the Hugo construct that best matches what Obsidian would show:
+// an image becomes a figure shortcode, a block reference degrades to a
+// labeled link (the tool has no way to inline the block itself), and
+// everything else becomes a ref-embed shortcode, with the heading carried
+// through as an anchor when present.
+func renderEmbed(target string) string {
+  modifier := ""
+  if pipeIndex := strings.Index(target, "|"); pipeIndex != -1 {
+    modifier = target[pipeIndex+1:]
+    target = target[:pipeIndex]
+  }
+
+  if caretIndex := strings.Index(target, "^"); caretIndex != -1 {
+    blockID := target[caretIndex+1:]
+    note := target[:caretIndex]
+    return fmt.Sprintf("[%s ^%s]({{< ref \"%s\" >}}#%s)", note, blockID, note, blockID)
+  }
+
+  if imageExtRegex.MatchString(target) {
+    if modifier != "" {
+      return fmt.Sprintf("{{< figure src=\"%s\" width=\"%s\" >}}", target, modifier)
+    }
+    return fmt.Sprintf("{{< figure src=\"%s\" >}}", target)
+  }
+
+  if hashIndex := strings.Index(target, "#"); hashIndex != -1 {
+    heading := target[hashIndex+1:]
+    note := target[:hashIndex]
+    anchor := strings.ToLower(strings.ReplaceAll(heading, " ", "-"))
+    return fmt.Sprintf("{{< ref-embed \"%s#%s\" >}}", note, anchor)
+  }
+
+  return fmt.Sprintf("{{< ref-embed \"%s\" >}}", target)
+}
+
+// usesEmbeds reports whether convertEmbeds is part of config's content
+// pipeline.
+func usesEmbeds(config Config) bool {
+  name := funcName(convertEmbeds)
+  for _, processor := range config.ContentProcessors {
+    if funcName(processor) == name {
+      return true
+    }
+  }
+
+  return false
+}
+
+// hugoConfigFilenames are the config file names Hugo itself looks for at a
+// site's root, in the order `hugo config` documents checking them.
+var hugoConfigFilenames = []string{
+  "hugo.toml", "hugo.yaml", "hugo.yml", "hugo.json",
+  "config.toml", "config.yaml", "config.yml", "config.json",
+}
+
+// detectSiteDir walks up from outputDir looking for a directory holding a
+// Hugo config file, since OutputDir ("-content-path") is explicitly allowed
+// to be a subdirectory of the real content root, not the site root itself.
+// It falls back to outputDir when no config file is found anywhere above it.
+func detectSiteDir(outputDir string) string {
+  dir := outputDir
+
+  for {
+    for _, name := range hugoConfigFilenames {
+      if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+        return dir
+      }
+    }
+
+    parent := filepath.Dir(dir)
+    if parent == dir {
+      return outputDir
+    }
+    dir = parent
+  }
+}
+
+// siteDir resolves the Hugo site root: config.SiteDir if the caller set it
+// explicitly, otherwise the result of detectSiteDir.
+func siteDir(config Config) string {
+  if config.SiteDir != "" {
+    return config.SiteDir
+  }
+
+  return detectSiteDir(config.OutputDir)
+}
+
+// ensureRefEmbedShortcode writes the `ref-embed` shortcode that
+// convertEmbeds's output depends on into the Hugo site's shortcodes
+// directory, unless one is already there.
+func ensureRefEmbedShortcode(config Config) error {
+  shortcodePath := filepath.Join(siteDir(config), "layouts", "shortcodes", "ref-embed.html")
+
+  if _, err := os.Stat(shortcodePath); err == nil {
+    return nil
+  }
+
+  if err := os.MkdirAll(filepath.Dir(shortcodePath), 0755); err != nil {
+    return err
+  }
+
+  return os.WriteFile(shortcodePath, []byte(refEmbedShortcodeTemplate), 0644)
+}
+
 /// Parses the frontmatter from the file, returns the frontmatter and the rest of the
 /// file's contents.
 func parseFrontMatter(config Config, file File) (FrontMatter, []byte, error) {
@@ -151,13 +489,52 @@ func marshalFrontMatter(frontMatter *FrontMatter) []byte {
   return []byte(fmt.Sprintf("---\n%s---", marshalled))
 }
 
-func convertFile(config Config, fromPath string, toPath string) error {
+func funcName(fn interface{}) string {
+  return runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+}
+
+// processorConfigHash identifies the processor pipeline itself, so that
+// enabling/disabling/reordering processors invalidates cached output even
+// when the source file hasn't changed.
+func processorConfigHash(config Config) string {
+  var names []string
+  for _, processor := range config.FrontMatterProcessors {
+    names = append(names, funcName(processor))
+  }
+  for _, processor := range config.ContentProcessors {
+    names = append(names, funcName(processor))
+  }
+
+  sum := sha256.Sum256([]byte(strings.Join(names, "|")))
+  return hex.EncodeToString(sum[:])
+}
+
+// fileCacheID identifies the rendered output for fromPath by the source's
+// mtime and size, the converter's own version, the processor pipeline in use
+// and the folder-rule settings. Commit history is not part of the id, so a
+// new commit that leaves the source file untouched does not refresh the
+// dates in its cached output.
+func fileCacheID(config Config, fromPath string, info os.FileInfo) string {
+  return strings.Join([]string{
+    fromPath,
+    strconv.FormatInt(info.ModTime().UnixNano(), 10),
+    strconv.FormatInt(info.Size(), 10),
+    converterVersion,
+    processorConfigHash(config),
+    strings.Join(config.DraftFolders, "\x01"),
+    strconv.FormatBool(config.TagFromFolder),
+  }, "\x00")
+}
+
+// renderFile reads fromPath, runs it through the processor pipeline, and
+// returns the rendered Hugo content. It writes nothing; besides reading the
+// source, the only I/O is what the processors read (file stats, commit history).
+func renderFile(config Config, fromPath string) ([]byte, error) {
   var file File
-  defer wg.Done()
 
   contents, err := os.ReadFile(fromPath)
   if err != nil {
-    return err
+    return nil, err
   }
 
   file.Path = fromPath
@@ -167,7 +544,7 @@ func convertFile(config Config, fromPath string, toPath string) error {
 
   frontMatter, body, err := parseFrontMatter(config, file)
   if err != nil {
-    return err
+    return nil, err
   }
 
   for _, processor := range config.ContentProcessors {
@@ -179,46 +556,205 @@ func convertFile(config Config, fromPath string, toPath string) error {
   }
 
   marshalledFrontMatter := marshalFrontMatter(&frontMatter)
-  file.Contents = []byte(fmt.Sprintf("%s\n%s", marshalledFrontMatter, string(body)))
+  return []byte(fmt.Sprintf("%s\n%s", marshalledFrontMatter, string(body))), nil
+}
+
+func convertFile(config Config, fileCache *cache.Cache, fromPath string, toPath string) error {
+  defer wg.Done()
 
-  err = os.WriteFile(toPath, file.Contents, 0644)
+  info, err := os.Stat(fromPath)
   if err != nil {
     return err
   }
 
-  return nil
+  rendered, err := fileCache.GetOrCreateBytes(fileCacheID(config, fromPath, info), func() ([]byte, error) {
+    return renderFile(config, fromPath)
+  })
+  if err != nil {
+    return err
+  }
+
+  if existing, err := os.ReadFile(toPath); err == nil && bytes.Equal(existing, rendered) {
+    return nil
+  }
+
+  return os.WriteFile(toPath, rendered, 0644)
 }
 
-func convertAllRecursively(config Config, fromDirPath string, toDirPath string) error {
-  var err error
+// conversionErrors collects per-file conversion errors from concurrent
+// convertFile calls so a single bad note can't silently vanish into a
+// discarded goroutine error.
+type conversionErrors struct {
+  mu sync.Mutex
+  errs []error
+}
 
-  files, err := os.ReadDir(fromDirPath)
-  if err != nil {
-    return err
+func (c *conversionErrors) add(err error) {
+  if err == nil {
+    return
+  }
+
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  c.errs = append(c.errs, err)
+}
+
+func (c *conversionErrors) combined() error {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+
+  if len(c.errs) == 0 {
+    return nil
+  }
+
+  messages := make([]string, len(c.errs))
+  for i, err := range c.errs {
+    messages[i] = err.Error()
   }
 
-  for _, file := range files {
-    name := file.Name()
-    if name[0] == '.' {
+  return fmt.Errorf("%d file(s) failed to convert:\n%s", len(c.errs), strings.Join(messages, "\n"))
+}
+
+// matchesAny reports whether relPath matches any of the given patterns.
+// A pattern is first tried as a folder (matching relPath itself or anything
+// nested under it, the same subtree rule matchesFolder applies to
+// DraftFolders/FolderMappings) and, failing that, as a plain glob - since
+// filepath.Match never matches across "/", a folder-style pattern like
+// "Private/" would otherwise only exclude files directly inside it and miss
+// anything nested deeper.
+func matchesAny(patterns []string, relPath string) bool {
+  if matchesFolder(patterns, relPath) {
+    return true
+  }
+
+  for _, pattern := range patterns {
+    if ok, err := filepath.Match(pattern, relPath); err == nil && ok {
+      return true
+    }
+  }
+
+  return false
+}
+
+// shouldConvert applies Include/Exclude to a vault-relative path: Include,
+// if non-empty, is an allowlist; Exclude always wins over Include.
+func shouldConvert(config Config, relPath string) bool {
+  if len(config.Include) > 0 && !matchesAny(config.Include, relPath) {
+    return false
+  }
+
+  return !matchesAny(config.Exclude, relPath)
+}
+
+// mapOutputDir resolves the output directory for a vault-relative source
+// directory, honoring the longest matching FolderMappings entry and falling
+// back to mirroring the source layout under OutputDir.
+func mapOutputDir(config Config, relDir string) string {
+  bestSource, bestMapped := "", ""
+
+  for source, mapped := range config.FolderMappings {
+    source = strings.Trim(source, "/")
+    if relDir != source && !strings.HasPrefix(relDir, source+"/") {
       continue
     }
+    if len(source) > len(bestSource) {
+      bestSource, bestMapped = source, mapped
+    }
+  }
 
-    fromFullPath := path.Join(fromDirPath, name)
-    toFullPath := path.Join(toDirPath, name)
+  if bestSource == "" {
+    return filepath.Join(config.OutputDir, relDir)
+  }
+
+  // bestMapped is rooted at the Hugo site, not OutputDir - OutputDir itself
+  // is only "-content-path", which is explicitly allowed to already be a
+  // subdirectory of the site's content root (e.g. content/posts), so joining
+  // a mapping like "content/posts" onto it would double that prefix.
+  remainder := strings.TrimPrefix(strings.TrimPrefix(relDir, bestSource), "/")
+  return filepath.Join(siteDir(config), bestMapped, remainder)
+}
+
+// outputPathFor resolves the full output path for a vault-relative source
+// file path.
+func outputPathFor(config Config, relPath string) string {
+  relDir := path.Dir(relPath)
+  if relDir == "." {
+    relDir = ""
+  }
+
+  return filepath.Join(mapOutputDir(config, relDir), path.Base(relPath))
+}
 
-    if file.IsDir() {
-      err = os.Mkdir(toFullPath, 0755)
-      if err != nil && os.IsNotExist(err) {
+// discoverFiles walks VaultDir and returns the vault-relative paths of every
+// regular file that should be converted, skipping dotfiles/dotdirs and
+// anything excluded by Include/Exclude.
+func discoverFiles(config Config) ([]string, error) {
+  var relPaths []string
+
+  err := filepath.WalkDir(config.VaultDir, func(fullPath string, entry fs.DirEntry, err error) error {
+    if err != nil {
+      return err
+    }
+    if fullPath == config.VaultDir {
+      return nil
+    }
+
+    if entry.Name()[0] == '.' {
+      if entry.IsDir() {
+        return filepath.SkipDir
+      }
+      return nil
+    }
+
+    if entry.IsDir() {
+      return nil
+    }
+
+    relPath := relativeToVault(config, fullPath)
+    if shouldConvert(config, relPath) {
+      relPaths = append(relPaths, relPath)
+    }
+
+    return nil
+  })
+
+  return relPaths, err
+}
+
+// sweepStaleOutputs removes everything under dirPath that this run did not
+// produce: files outside written are removed outright, and a directory
+// outside written is removed once it is empty after that sweep. Files under
+// dirPath that were not written by this tool are removed the same way.
+func sweepStaleOutputs(dirPath string, written *writtenPaths) error {
+  entries, err := os.ReadDir(dirPath)
+  if err != nil {
+    return err
+  }
+
+  for _, entry := range entries {
+    fullPath := path.Join(dirPath, entry.Name())
+
+    if entry.IsDir() {
+      if err := sweepStaleOutputs(fullPath, written); err != nil {
         return err
       }
 
-      err := convertAllRecursively(config, fromFullPath, toFullPath)
-      if err != nil {
+      if !written.has(fullPath) {
+        remaining, err := os.ReadDir(fullPath)
+        if err == nil && len(remaining) == 0 {
+          if err := os.Remove(fullPath); err != nil {
+            return err
+          }
+        }
+      }
+
+      continue
+    }
+
+    if !written.has(fullPath) {
+      if err := os.Remove(fullPath); err != nil {
         return err
       }
-    } else {
-      wg.Add(1)
-      go convertFile(config, fromFullPath, toFullPath)
     }
   }
 
@@ -226,8 +762,7 @@ func convertAllRecursively(config Config, fromDirPath string, toDirPath string)
 }
 
 func ConvertObsidianToHugo(config Config) error {
-  // clean up the output directory
-  err := os.RemoveAll(config.OutputDir)
+  fileCache, err := cache.New(config.CacheDir)
   if err != nil {
     return err
   }
@@ -237,7 +772,55 @@ func ConvertObsidianToHugo(config Config) error {
     return err
   }
 
-  return convertAllRecursively(config, config.VaultDir, config.OutputDir)
+  relPaths, err := discoverFiles(config)
+  if err != nil {
+    return err
+  }
+
+  written := newWrittenPaths()
+  convErrs := &conversionErrors{}
+
+  for _, relPath := range relPaths {
+    fromFullPath := filepath.Join(config.VaultDir, relPath)
+    toFullPath := outputPathFor(config, relPath)
+
+    if err := os.MkdirAll(filepath.Dir(toFullPath), 0755); err != nil {
+      return err
+    }
+
+    // These mark what discoverFiles says *should* exist, independent of
+    // whether this run's conversion actually succeeds below - a transient
+    // per-file failure must not make sweepStaleOutputs treat a previously
+    // good, still-present source as gone.
+    written.add(filepath.Dir(toFullPath))
+    written.add(toFullPath)
+
+    wg.Add(1)
+    go func(fromFullPath string, toFullPath string) {
+      if err := convertFile(config, fileCache, fromFullPath, toFullPath); err != nil {
+        fmt.Println(err)
+        convErrs.add(err)
+      }
+    }(fromFullPath, toFullPath)
+  }
+
+  wg.Wait()
+
+  if err := sweepStaleOutputs(config.OutputDir, written); err != nil {
+    return err
+  }
+
+  // Must run after the sweep above, not before: when siteDir(config) falls
+  // back to OutputDir itself (no Hugo config file found above it), the
+  // shortcode lands inside the tree sweepStaleOutputs cleans, and anything
+  // written before the sweep that isn't a tracked note output gets deleted.
+  if usesEmbeds(config) {
+    if err := ensureRefEmbedShortcode(config); err != nil {
+      return err
+    }
+  }
+
+  return convErrs.combined()
 }
 
 func main() {
@@ -254,25 +837,62 @@ func main() {
     os.Exit(1)
   }
 
-  err := ConvertObsidianToHugo(Config{
+  resolvedConfigPath := *configPath
+  if resolvedConfigPath == "" {
+    if _, err := os.Stat(defaultConfigFilename); err == nil {
+      resolvedConfigPath = defaultConfigFilename
+    }
+  }
+
+  var fileConfig FileConfig
+  if resolvedConfigPath != "" {
+    var err error
+    fileConfig, err = LoadConfigFile(resolvedConfigPath)
+    if err != nil {
+      fmt.Println(err)
+      os.Exit(1)
+    }
+  }
+
+  vcsDateProcessor := NewVCSDateProcessor(*vaultDir)
+  RegisterFrontMatterProcessor("vcs-date", vcsDateProcessor.AddFrontMatterDates)
+
+  processorNames := fileConfig.Processors
+  if len(processorNames) == 0 {
+    processorNames = defaultProcessorNames
+  }
+  frontMatterProcessors, contentProcessors := resolveProcessors(processorNames)
+
+  resolvedSiteDir := *sitePath
+  if resolvedSiteDir == "" {
+    resolvedSiteDir = fileConfig.SiteDir
+  }
+
+  config := Config{
     VaultDir: *vaultDir,
     OutputDir: *outputDir,
-    FrontMatterProcessors: []FrontMatterProcessor{
-      addFallbackFrontMatterTitle,
-      addFallbackFrontMatterSlug,
-      addFallbackFrontMatterDate,
-    },
-    ContentProcessors: []ContentProcessor{
-      convertWikiLinks,
-    },
-  })
+    CacheDir: *cacheDir,
+    SiteDir: resolvedSiteDir,
+    Include: fileConfig.Include,
+    Exclude: fileConfig.Exclude,
+    FolderMappings: fileConfig.FolderMappings,
+    DraftFolders: fileConfig.DraftFolders,
+    TagFromFolder: fileConfig.TagFromFolder,
+    FrontMatterProcessors: frontMatterProcessors,
+    ContentProcessors: contentProcessors,
+  }
+
+  var err error
+  if *watch {
+    err = watchAndConvert(config)
+  } else {
+    err = ConvertObsidianToHugo(config)
+  }
 
   if err != nil {
     fmt.Println(err)
     os.Exit(1)
   }
 
-  wg.Wait()
-
   os.Exit(0)
 }
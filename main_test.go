@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestConvertWikiLinks(t *testing.T) {
+  cases := []struct {
+    name string
+    input string
+    expected string
+  }{
+    {"plain link", "[[Note]]", `[Note]({{< ref "Note" >}})`},
+    {"heading link", "[[Note#Some Heading]]", `[Note]({{< ref "Note#some-heading" >}})`},
+    {"alias link", "[[Note|Display Text]]", `[Display Text]({{< ref "Note" >}})`},
+    {"alias with heading", "[[Note#Some Heading|Display]]", `[Display]({{< ref "Note#some-heading" >}})`},
+  }
+
+  for _, c := range cases {
+    t.Run(c.name, func(t *testing.T) {
+      got := string(convertWikiLinks(Config{}, File{}, []byte(c.input)))
+      if got != c.expected {
+        t.Errorf("convertWikiLinks(%q) = %q, want %q", c.input, got, c.expected)
+      }
+    })
+  }
+}
+
+func TestConvertEmbeds(t *testing.T) {
+  cases := []struct {
+    name string
+    input string
+    expected string
+  }{
+    {"note embed", "![[Note]]", `{{< ref-embed "Note" >}}`},
+    {"heading embed", "![[Note#Some Heading]]", `{{< ref-embed "Note#some-heading" >}}`},
+    {"image embed with width", "![[image.png|300]]", `{{< figure src="image.png" width="300" >}}`},
+    {"image embed without width", "![[image.png]]", `{{< figure src="image.png" >}}`},
+    {"block reference", "![[Note^abc123]]", `[Note ^abc123]({{< ref "Note" >}}#abc123)`},
+  }
+
+  for _, c := range cases {
+    t.Run(c.name, func(t *testing.T) {
+      got := string(convertEmbeds(Config{}, File{}, []byte(c.input)))
+      if got != c.expected {
+        t.Errorf("convertEmbeds(%q) = %q, want %q", c.input, got, c.expected)
+      }
+    })
+  }
+}
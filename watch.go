@@ -0,0 +1,157 @@
+package main
+
+import (
+  "fmt"
+  "io/fs"
+  "os"
+  "path/filepath"
+  "sync"
+  "time"
+
+  "github.com/JenkinsDev/obsidian-for-hugo/cache"
+  "github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce coalesces fsnotify's save-then-rename pattern into a single
+// reconvert per path.
+const watchDebounce = 200 * time.Millisecond
+
+// debouncer calls fn once per key, watchDebounce after the last trigger for
+// that key, restarting the wait on every new trigger in between.
+type debouncer struct {
+  mu sync.Mutex
+  timers map[string]*time.Timer
+  delay time.Duration
+  fn func(string)
+}
+
+func newDebouncer(delay time.Duration, fn func(string)) *debouncer {
+  return &debouncer{timers: make(map[string]*time.Timer), delay: delay, fn: fn}
+}
+
+func (d *debouncer) trigger(key string) {
+  d.mu.Lock()
+  defer d.mu.Unlock()
+
+  if timer, ok := d.timers[key]; ok {
+    timer.Stop()
+  }
+
+  d.timers[key] = time.AfterFunc(d.delay, func() {
+    d.mu.Lock()
+    delete(d.timers, key)
+    d.mu.Unlock()
+
+    d.fn(key)
+  })
+}
+
+// addWatchesRecursively adds watches for dirPath and every non-dotfile
+// subdirectory under it.
+func addWatchesRecursively(watcher *fsnotify.Watcher, dirPath string) error {
+  return filepath.WalkDir(dirPath, func(fullPath string, entry fs.DirEntry, err error) error {
+    if err != nil {
+      return err
+    }
+    if !entry.IsDir() {
+      return nil
+    }
+    if fullPath != dirPath && entry.Name()[0] == '.' {
+      return filepath.SkipDir
+    }
+
+    return watcher.Add(fullPath)
+  })
+}
+
+// watchAndConvert runs one full conversion, then watches config.VaultDir and
+// reconverts individual files as they change. Watcher errors are printed and
+// watching continues; it returns only once the watcher's channels are closed.
+// It shares config's pipeline and Include/Exclude rules with one-shot mode.
+func watchAndConvert(config Config) error {
+  if err := ConvertObsidianToHugo(config); err != nil {
+    return err
+  }
+
+  fileCache, err := cache.New(config.CacheDir)
+  if err != nil {
+    return err
+  }
+
+  watcher, err := fsnotify.NewWatcher()
+  if err != nil {
+    return err
+  }
+  defer watcher.Close()
+
+  if err := addWatchesRecursively(watcher, config.VaultDir); err != nil {
+    return err
+  }
+
+  debounced := newDebouncer(watchDebounce, func(fullPath string) {
+    handleWatchEvent(config, fileCache, watcher, fullPath)
+  })
+
+  for {
+    select {
+    case event, ok := <-watcher.Events:
+      if !ok {
+        return nil
+      }
+      debounced.trigger(event.Name)
+    case err, ok := <-watcher.Errors:
+      if !ok {
+        return nil
+      }
+      fmt.Println(err)
+    }
+  }
+}
+
+// handleWatchEvent reconverts the single file behind a (debounced) fsnotify
+// event, adds watches for newly created subdirectories, and removes the
+// output for sources that were deleted or renamed away.
+func handleWatchEvent(config Config, fileCache *cache.Cache, watcher *fsnotify.Watcher, fullPath string) {
+  info, err := os.Stat(fullPath)
+  if err != nil {
+    removeWatchOutput(config, fullPath)
+    return
+  }
+
+  if info.IsDir() {
+    if err := addWatchesRecursively(watcher, fullPath); err != nil {
+      fmt.Println(err)
+    }
+    return
+  }
+
+  relPath := relativeToVault(config, fullPath)
+  if !shouldConvert(config, relPath) {
+    return
+  }
+
+  toFullPath := outputPathFor(config, relPath)
+  if err := os.MkdirAll(filepath.Dir(toFullPath), 0755); err != nil {
+    fmt.Println(err)
+    return
+  }
+
+  wg.Add(1)
+  if err := convertFile(config, fileCache, fullPath, toFullPath); err != nil {
+    fmt.Println(err)
+  }
+}
+
+// removeWatchOutput deletes the output file corresponding to a source path
+// that's no longer on disk.
+func removeWatchOutput(config Config, fullPath string) {
+  relPath := relativeToVault(config, fullPath)
+  if !shouldConvert(config, relPath) {
+    return
+  }
+
+  toFullPath := outputPathFor(config, relPath)
+  if err := os.Remove(toFullPath); err != nil && !os.IsNotExist(err) {
+    fmt.Println(err)
+  }
+}